@@ -0,0 +1,263 @@
+package sqlxcache
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Conn is a single physical connection pinned out of the primary's pool,
+// for operations that need session-level state to persist across several
+// statements without opening a transaction: Postgres advisory locks,
+// LISTEN/NOTIFY, temp tables, SET LOCAL outside a tx, and the like.
+//
+// Statements prepared on a Conn are re-prepared directly against its
+// pinned connection rather than routed through the primary's statement
+// cache, since a statement bound to one physical connection cannot be
+// reused on another. They live for the lifetime of the Conn and are
+// closed when the connection is returned via Close.
+type Conn struct {
+	c     *Cache
+	conn  *sqlx.Conn
+	stmts map[string]*sqlx.Stmt
+}
+
+// Conn checks out a single connection from the primary pool. The caller
+// must call Close to return it.
+func (c *Cache) Conn(ctx context.Context) (*Conn, error) {
+	conn, err := c.primary.db.Connx(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Conn{
+		c:     c,
+		conn:  conn,
+		stmts: map[string]*sqlx.Stmt{},
+	}, nil
+}
+
+func (conn *Conn) stmtContext(ctx context.Context, query string) (*sqlx.Stmt, error) {
+	stmt, ok := conn.stmts[query]
+	if ok {
+		return stmt, nil
+	}
+
+	stmt, err := conn.conn.PreparexContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	conn.stmts[query] = stmt
+	return stmt, nil
+}
+
+// namedStmtContext binds query's named parameters against arg itself,
+// since *sqlx.Conn (unlike *sqlx.DB) has no named-prepare primitive in
+// this version of sqlx. The bound query is then prepared and cached like
+// any other statement on conn. Binding happens on every call, but for a
+// given query string bound against the same struct type this yields the
+// same positional query, so the statement cache still hits.
+func (conn *Conn) namedStmtContext(ctx context.Context, query string, arg interface{}) (*sqlx.Stmt, []interface{}, error) {
+	boundQuery, args, err := sqlx.BindNamed(sqlx.BindType(conn.c.primary.db.DriverName()), query, arg)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	stmt, err := conn.stmtContext(ctx, boundQuery)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return stmt, args, nil
+}
+
+func (conn *Conn) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return conn.ExecContext(context.Background(), query, args...)
+}
+
+func (conn *Conn) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	stmt, err := conn.stmtContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	return stmt.ExecContext(ctx, args...)
+}
+
+func (conn *Conn) NamedExec(query string, arg interface{}) (sql.Result, error) {
+	return conn.NamedExecContext(context.Background(), query, arg)
+}
+
+func (conn *Conn) NamedExecContext(ctx context.Context, query string, arg interface{}) (sql.Result, error) {
+	stmt, args, err := conn.namedStmtContext(ctx, query, arg)
+	if err != nil {
+		return nil, err
+	}
+
+	return stmt.ExecContext(ctx, args...)
+}
+
+func (conn *Conn) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return conn.QueryContext(context.Background(), query, args...)
+}
+
+func (conn *Conn) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	stmt, err := conn.stmtContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	return stmt.QueryContext(ctx, args...)
+}
+
+func (conn *Conn) NamedQuery(query string, arg interface{}) (*sql.Rows, error) {
+	return conn.NamedQueryContext(context.Background(), query, arg)
+}
+
+func (conn *Conn) NamedQueryContext(ctx context.Context, query string, arg interface{}) (*sql.Rows, error) {
+	stmt, args, err := conn.namedStmtContext(ctx, query, arg)
+	if err != nil {
+		return nil, err
+	}
+
+	return stmt.QueryContext(ctx, args...)
+}
+
+func (conn *Conn) Queryx(query string, args ...interface{}) (*sqlx.Rows, error) {
+	return conn.QueryxContext(context.Background(), query, args...)
+}
+
+func (conn *Conn) QueryxContext(ctx context.Context, query string, args ...interface{}) (*sqlx.Rows, error) {
+	stmt, err := conn.stmtContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	return stmt.QueryxContext(ctx, args...)
+}
+
+func (conn *Conn) NamedQueryx(query string, arg interface{}) (*sqlx.Rows, error) {
+	return conn.NamedQueryxContext(context.Background(), query, arg)
+}
+
+func (conn *Conn) NamedQueryxContext(ctx context.Context, query string, arg interface{}) (*sqlx.Rows, error) {
+	stmt, args, err := conn.namedStmtContext(ctx, query, arg)
+	if err != nil {
+		return nil, err
+	}
+
+	return stmt.QueryxContext(ctx, args...)
+}
+
+func (conn *Conn) QueryxRow(query string, args ...interface{}) (*sqlx.Row, error) {
+	return conn.QueryRowxContext(context.Background(), query, args...)
+}
+
+func (conn *Conn) QueryRowxContext(ctx context.Context, query string, args ...interface{}) (*sqlx.Row, error) {
+	stmt, err := conn.stmtContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	return stmt.QueryRowxContext(ctx, args...), nil
+}
+
+func (conn *Conn) NamedQueryRow(query string, arg interface{}) (*sqlx.Row, error) {
+	return conn.NamedQueryRowContext(context.Background(), query, arg)
+}
+
+func (conn *Conn) NamedQueryRowContext(ctx context.Context, query string, arg interface{}) (*sqlx.Row, error) {
+	stmt, args, err := conn.namedStmtContext(ctx, query, arg)
+	if err != nil {
+		return nil, err
+	}
+
+	return stmt.QueryRowxContext(ctx, args...), nil
+}
+
+func (conn *Conn) Get(dest interface{}, query string, args ...interface{}) error {
+	return conn.GetContext(context.Background(), dest, query, args...)
+}
+
+func (conn *Conn) GetContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	stmt, err := conn.stmtContext(ctx, query)
+	if err != nil {
+		return err
+	}
+
+	return stmt.GetContext(ctx, dest, args...)
+}
+
+func (conn *Conn) NamedGet(dest interface{}, query string, arg interface{}) error {
+	return conn.NamedGetContext(context.Background(), dest, query, arg)
+}
+
+func (conn *Conn) NamedGetContext(ctx context.Context, dest interface{}, query string, arg interface{}) error {
+	stmt, args, err := conn.namedStmtContext(ctx, query, arg)
+	if err != nil {
+		return err
+	}
+
+	return stmt.GetContext(ctx, dest, args...)
+}
+
+func (conn *Conn) Select(dest interface{}, query string, args ...interface{}) error {
+	return conn.SelectContext(context.Background(), dest, query, args...)
+}
+
+func (conn *Conn) SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	stmt, err := conn.stmtContext(ctx, query)
+	if err != nil {
+		return err
+	}
+
+	return stmt.SelectContext(ctx, dest, args...)
+}
+
+func (conn *Conn) NamedSelect(dest interface{}, query string, arg interface{}) error {
+	return conn.NamedSelectContext(context.Background(), dest, query, arg)
+}
+
+func (conn *Conn) NamedSelectContext(ctx context.Context, dest interface{}, query string, arg interface{}) error {
+	stmt, args, err := conn.namedStmtContext(ctx, query, arg)
+	if err != nil {
+		return err
+	}
+
+	return stmt.SelectContext(ctx, dest, args...)
+}
+
+// BeginTx opens a transaction pinned to conn's underlying connection.
+func (conn *Conn) BeginTx(ctx context.Context, opts *sql.TxOptions) (*Tx, error) {
+	tx, err := conn.conn.BeginTxx(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Tx{
+		c:          conn.c,
+		tx:         tx,
+		stmts:      map[string]*sqlx.Stmt{},
+		namedStmts: map[string]*sqlx.NamedStmt{},
+		tree:       &txTree{},
+	}, nil
+}
+
+// Close closes every statement prepared on conn and returns the
+// connection to the primary's pool.
+func (conn *Conn) Close() error {
+	var firstErr error
+	for _, stmt := range conn.stmts {
+		if err := stmt.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	if err := conn.conn.Close(); err != nil && firstErr == nil {
+		firstErr = err
+	}
+
+	return firstErr
+}
@@ -0,0 +1,88 @@
+package sqlxcache
+
+import (
+	"context"
+	"time"
+)
+
+// Hooks lets callers observe every query and prepare run through a Cache
+// (and any Tx derived from it, including one from Conn.BeginTx), in the
+// spirit of OpenTelemetry instrumentation. The query methods of Conn
+// itself do not call Hooks. Implementations must be safe for concurrent
+// use.
+type Hooks interface {
+	// BeforeQuery is called before Exec/Query/Get/Select/NamedXxx runs
+	// query with args. The returned context is threaded through to the
+	// matching AfterQuery call, so it can carry e.g. a started span.
+	BeforeQuery(ctx context.Context, query string, args []interface{}) context.Context
+
+	// AfterQuery is called once query has finished executing.
+	AfterQuery(ctx context.Context, query string, args []interface{}, err error, duration time.Duration)
+
+	// BeforePrepare is called before query is prepared because it was not
+	// already in the statement cache.
+	BeforePrepare(ctx context.Context, query string) context.Context
+
+	// AfterPrepare is called once that prepare has finished.
+	AfterPrepare(ctx context.Context, query string, err error, duration time.Duration)
+
+	// CacheHit reports whether query was already in the statement cache,
+	// for tracking the cache's hit rate. The returned context is threaded
+	// through to the matching AfterQuery call, so hooks that need to carry
+	// the hit/miss outcome there can stash it with context.WithValue
+	// instead of keying a side table on the query string (which is racy
+	// under concurrent calls for the same query).
+	CacheHit(ctx context.Context, query string, hit bool) context.Context
+}
+
+// noopHooks is the default Hooks used when CacheOptions.Hooks is unset.
+type noopHooks struct{}
+
+func (noopHooks) BeforeQuery(ctx context.Context, query string, args []interface{}) context.Context {
+	return ctx
+}
+
+func (noopHooks) AfterQuery(ctx context.Context, query string, args []interface{}, err error, duration time.Duration) {
+}
+
+func (noopHooks) BeforePrepare(ctx context.Context, query string) context.Context {
+	return ctx
+}
+
+func (noopHooks) AfterPrepare(ctx context.Context, query string, err error, duration time.Duration) {
+}
+
+func (noopHooks) CacheHit(ctx context.Context, query string, hit bool) context.Context { return ctx }
+
+// acquire fetches query's cache entry from cache, preparing it with
+// create on a miss, and reports BeforePrepare/AfterPrepare/CacheHit on
+// hooks. The caller must release the returned entry via cache.release.
+// The returned context is the one CacheHit produced and must be used for
+// the matching AfterQuery call.
+func acquire(ctx context.Context, hooks Hooks, cache *lruCache, query string, create func() (closer, error)) (*cacheEntry, context.Context, error) {
+	entry, hit, err := cache.getOrCreate(query, func() (closer, error) {
+		prepareCtx := hooks.BeforePrepare(ctx, query)
+		start := time.Now()
+		value, err := create()
+		hooks.AfterPrepare(prepareCtx, query, err, time.Since(start))
+		return value, err
+	})
+
+	ctx = hooks.CacheHit(ctx, query, hit)
+	if err != nil {
+		return nil, ctx, err
+	}
+
+	return entry, ctx, nil
+}
+
+// beforeQuery and afterQuery are small wrappers kept on Cache so every
+// Exec/Query/Get/Select/NamedXxx method can bracket its work with hooks
+// in two lines, regardless of its return type.
+func (c *Cache) beforeQuery(ctx context.Context, query string, args []interface{}) (context.Context, time.Time) {
+	return c.hooks.BeforeQuery(ctx, query, args), time.Now()
+}
+
+func (c *Cache) afterQuery(ctx context.Context, query string, args []interface{}, start time.Time, err error) {
+	c.hooks.AfterQuery(ctx, query, args, err, time.Since(start))
+}
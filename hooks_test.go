@@ -0,0 +1,127 @@
+package sqlxcache
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// recordingHooks records every hook call it receives, for asserting call
+// order and arguments without a real tracing/metrics backend.
+type recordingHooks struct {
+	mu    sync.Mutex
+	calls []string
+	hits  []bool
+}
+
+func (h *recordingHooks) record(call string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.calls = append(h.calls, call)
+}
+
+func (h *recordingHooks) BeforeQuery(ctx context.Context, query string, args []interface{}) context.Context {
+	h.record("BeforeQuery")
+	return ctx
+}
+
+func (h *recordingHooks) AfterQuery(ctx context.Context, query string, args []interface{}, err error, duration time.Duration) {
+	h.record("AfterQuery")
+}
+
+func (h *recordingHooks) BeforePrepare(ctx context.Context, query string) context.Context {
+	h.record("BeforePrepare")
+	return ctx
+}
+
+func (h *recordingHooks) AfterPrepare(ctx context.Context, query string, err error, duration time.Duration) {
+	h.record("AfterPrepare")
+}
+
+func (h *recordingHooks) CacheHit(ctx context.Context, query string, hit bool) context.Context {
+	h.mu.Lock()
+	h.hits = append(h.hits, hit)
+	h.mu.Unlock()
+	h.record("CacheHit")
+	return ctx
+}
+
+func TestAcquireReportsCacheHitAndPrepareOnMiss(t *testing.T) {
+	hooks := &recordingHooks{}
+	cache := newLRUCache(0)
+
+	a := &fakeCloser{}
+	_, ctx, err := acquire(context.Background(), hooks, cache, "query", newFakeCreate(a))
+	if err != nil {
+		t.Fatalf("acquire: %v", err)
+	}
+	if ctx == nil {
+		t.Fatal("acquire returned a nil context")
+	}
+
+	if got := hooks.calls; len(got) != 3 || got[0] != "BeforePrepare" || got[1] != "AfterPrepare" || got[2] != "CacheHit" {
+		t.Errorf("acquire on a miss called hooks in order %v, want [BeforePrepare AfterPrepare CacheHit]", got)
+	}
+	if len(hooks.hits) != 1 || hooks.hits[0] {
+		t.Errorf("acquire on a miss reported CacheHit(hit=%v), want false", hooks.hits)
+	}
+}
+
+func TestAcquireReportsCacheHitWithoutPrepareOnHit(t *testing.T) {
+	hooks := &recordingHooks{}
+	cache := newLRUCache(0)
+
+	a := &fakeCloser{}
+	entry, _, err := acquire(context.Background(), hooks, cache, "query", newFakeCreate(a))
+	if err != nil {
+		t.Fatalf("first acquire: %v", err)
+	}
+	cache.release(entry)
+	hooks.calls = nil
+	hooks.hits = nil
+
+	_, _, err = acquire(context.Background(), hooks, cache, "query", newFakeCreate(&fakeCloser{}))
+	if err != nil {
+		t.Fatalf("second acquire: %v", err)
+	}
+
+	if got := hooks.calls; len(got) != 1 || got[0] != "CacheHit" {
+		t.Errorf("acquire on a hit called hooks %v, want only [CacheHit]", got)
+	}
+	if len(hooks.hits) != 1 || !hooks.hits[0] {
+		t.Errorf("acquire on a hit reported CacheHit(hit=%v), want true", hooks.hits)
+	}
+}
+
+// TestTxReusesCachedStatementReportsCacheHit guards against regressing the
+// bug where Tx.stmtContext's tx-local fast path (the statement was already
+// bound to this Tx, so no prepare happens) skipped CacheHit entirely,
+// which promhooks then reports as a miss and otelhooks leaves untagged.
+func TestTxReusesCachedStatementReportsCacheHit(t *testing.T) {
+	db := sqlx.NewDb(newFakeSQLDB(t), "fakedriver")
+	hooks := &recordingHooks{}
+	c := New(db, CacheOptions{Hooks: hooks})
+
+	tx, err := c.Begin()
+	if err != nil {
+		t.Fatalf("Begin: %v", err)
+	}
+
+	const query = `SELECT 1`
+	if _, err := tx.Exec(query); err != nil {
+		t.Fatalf("first Exec: %v", err)
+	}
+	if len(hooks.hits) == 0 || hooks.hits[len(hooks.hits)-1] {
+		t.Fatalf("first Exec reported CacheHit(hit=%v), want false", hooks.hits)
+	}
+
+	if _, err := tx.Exec(query); err != nil {
+		t.Fatalf("second Exec: %v", err)
+	}
+	if len(hooks.hits) == 0 || !hooks.hits[len(hooks.hits)-1] {
+		t.Errorf("repeat Exec on an already tx-bound statement reported CacheHit(hit=%v), want true", hooks.hits)
+	}
+}
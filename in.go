@@ -0,0 +1,153 @@
+package sqlxcache
+
+import (
+	"context"
+	"database/sql"
+	"reflect"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// In expands sqlx.In-style "?" placeholders bound to slice args (e.g. for
+// "WHERE id IN (?)") into the right number of placeholders for query,
+// then rebinds the result to the primary's driver placeholder style.
+//
+// Because every distinct slice length produces a distinct expanded query
+// string, and each one gets its own entry in the statement cache, a
+// handful of IN lists with varying lengths can otherwise blow up the
+// cache. When CacheOptions.InExpansionBucket is set, slice args are first
+// padded with SQL NULL up to the next power-of-two length, collapsing the
+// set of distinct expanded queries dramatically.
+func (c *Cache) In(query string, args ...interface{}) (string, []interface{}, error) {
+	if c.inExpansionBucket {
+		args = padArgsToPowerOfTwo(args)
+	}
+
+	expandedQuery, expandedArgs, err := sqlx.In(query, args...)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return c.primary.db.Rebind(expandedQuery), expandedArgs, nil
+}
+
+func (c *Cache) ExecIn(query string, args ...interface{}) (sql.Result, error) {
+	expandedQuery, expandedArgs, err := c.In(query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.Exec(expandedQuery, expandedArgs...)
+}
+
+func (c *Cache) ExecInContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	expandedQuery, expandedArgs, err := c.In(query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.ExecContext(ctx, expandedQuery, expandedArgs...)
+}
+
+func (c *Cache) GetIn(dest interface{}, query string, args ...interface{}) error {
+	expandedQuery, expandedArgs, err := c.In(query, args...)
+	if err != nil {
+		return err
+	}
+
+	return c.Get(dest, expandedQuery, expandedArgs...)
+}
+
+func (c *Cache) GetInContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	expandedQuery, expandedArgs, err := c.In(query, args...)
+	if err != nil {
+		return err
+	}
+
+	return c.GetContext(ctx, dest, expandedQuery, expandedArgs...)
+}
+
+func (c *Cache) SelectIn(dest interface{}, query string, args ...interface{}) error {
+	expandedQuery, expandedArgs, err := c.In(query, args...)
+	if err != nil {
+		return err
+	}
+
+	return c.Select(dest, expandedQuery, expandedArgs...)
+}
+
+func (c *Cache) SelectInContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	expandedQuery, expandedArgs, err := c.In(query, args...)
+	if err != nil {
+		return err
+	}
+
+	return c.SelectContext(ctx, dest, expandedQuery, expandedArgs...)
+}
+
+func (c *Cache) QueryxIn(query string, args ...interface{}) (*sqlx.Rows, error) {
+	expandedQuery, expandedArgs, err := c.In(query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.Queryx(expandedQuery, expandedArgs...)
+}
+
+func (c *Cache) QueryxInContext(ctx context.Context, query string, args ...interface{}) (*sqlx.Rows, error) {
+	expandedQuery, expandedArgs, err := c.In(query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.QueryxContext(ctx, expandedQuery, expandedArgs...)
+}
+
+// padArgsToPowerOfTwo returns args with every slice-typed element (other
+// than []byte, which drivers treat as a single value) padded with nil up
+// to the next power-of-two length.
+func padArgsToPowerOfTwo(args []interface{}) []interface{} {
+	padded := make([]interface{}, len(args))
+	for i, arg := range args {
+		padded[i] = padArgToPowerOfTwo(arg)
+	}
+
+	return padded
+}
+
+func padArgToPowerOfTwo(arg interface{}) interface{} {
+	if _, ok := arg.([]byte); ok {
+		return arg
+	}
+
+	v := reflect.ValueOf(arg)
+	if v.Kind() != reflect.Slice {
+		return arg
+	}
+
+	n := v.Len()
+	target := nextPowerOfTwo(n)
+	if target == n {
+		return arg
+	}
+
+	padded := make([]interface{}, target)
+	for i := 0; i < n; i++ {
+		padded[i] = v.Index(i).Interface()
+	}
+
+	return padded
+}
+
+func nextPowerOfTwo(n int) int {
+	if n <= 1 {
+		return 1
+	}
+
+	p := 1
+	for p < n {
+		p <<= 1
+	}
+
+	return p
+}
@@ -0,0 +1,61 @@
+package sqlxcache
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNextPowerOfTwo(t *testing.T) {
+	cases := []struct {
+		n    int
+		want int
+	}{
+		{0, 1},
+		{1, 1},
+		{2, 2},
+		{3, 4},
+		{4, 4},
+		{5, 8},
+		{8, 8},
+		{9, 16},
+	}
+
+	for _, c := range cases {
+		if got := nextPowerOfTwo(c.n); got != c.want {
+			t.Errorf("nextPowerOfTwo(%d) = %d, want %d", c.n, got, c.want)
+		}
+	}
+}
+
+func TestPadArgToPowerOfTwo(t *testing.T) {
+	t.Run("pads slice to next power of two with nil", func(t *testing.T) {
+		got := padArgToPowerOfTwo([]int{1, 2, 3})
+		want := []interface{}{1, 2, 3, nil}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("padArgToPowerOfTwo([1, 2, 3]) = %#v, want %#v", got, want)
+		}
+	})
+
+	t.Run("leaves an already power-of-two slice alone", func(t *testing.T) {
+		arg := []int{1, 2}
+		got := padArgToPowerOfTwo(arg)
+		if !reflect.DeepEqual(got, arg) {
+			t.Errorf("padArgToPowerOfTwo([1, 2]) = %#v, want unchanged %#v", got, arg)
+		}
+	})
+
+	t.Run("leaves []byte alone", func(t *testing.T) {
+		arg := []byte("abc")
+		got := padArgToPowerOfTwo(arg)
+		if !reflect.DeepEqual(got, arg) {
+			t.Errorf("padArgToPowerOfTwo([]byte) = %#v, want unchanged %#v", got, arg)
+		}
+	})
+
+	t.Run("leaves non-slice args alone", func(t *testing.T) {
+		got := padArgToPowerOfTwo(42)
+		if got != 42 {
+			t.Errorf("padArgToPowerOfTwo(42) = %#v, want 42", got)
+		}
+	})
+}
@@ -0,0 +1,99 @@
+// Package otelhooks provides a sqlxcache.Hooks implementation that records
+// an OpenTelemetry span around every query and prepare run through a
+// sqlxcache.Cache (or any Tx derived from it; the query methods of a
+// sqlxcache.Conn call no hooks).
+//
+// It lives in its own module so that importing it is the only way to pull
+// in the OpenTelemetry SDK; the core sqlxcache module stays dependency-free.
+package otelhooks
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Hooks is a sqlxcache.Hooks that starts a span for each query and each
+// cache-miss prepare, tagging it with db.statement, db.system, and
+// (for queries) whether the statement cache was hit. Construct with New.
+type Hooks struct {
+	tracer trace.Tracer
+	system string
+}
+
+// New returns a Hooks that records spans on tracer. system is recorded as
+// the db.system attribute (e.g. "postgresql", "mysql").
+func New(tracer trace.Tracer, system string) *Hooks {
+	return &Hooks{tracer: tracer, system: system}
+}
+
+// NewDefault returns a Hooks using the global otel.Tracer for name.
+func NewDefault(name, system string) *Hooks {
+	return New(otel.Tracer(name), system)
+}
+
+type spanKey struct{}
+
+func (h *Hooks) BeforeQuery(ctx context.Context, query string, args []interface{}) context.Context {
+	ctx, span := h.tracer.Start(ctx, "sqlxcache.query",
+		trace.WithAttributes(
+			attribute.String("db.statement", query),
+			attribute.String("db.system", h.system),
+		),
+	)
+
+	return context.WithValue(ctx, spanKey{}, span)
+}
+
+func (h *Hooks) AfterQuery(ctx context.Context, query string, args []interface{}, err error, duration time.Duration) {
+	span, ok := ctx.Value(spanKey{}).(trace.Span)
+	if !ok {
+		return
+	}
+
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	span.End()
+}
+
+func (h *Hooks) BeforePrepare(ctx context.Context, query string) context.Context {
+	ctx, span := h.tracer.Start(ctx, "sqlxcache.prepare",
+		trace.WithAttributes(
+			attribute.String("db.statement", query),
+			attribute.String("db.system", h.system),
+		),
+	)
+
+	return context.WithValue(ctx, spanKey{}, span)
+}
+
+func (h *Hooks) AfterPrepare(ctx context.Context, query string, err error, duration time.Duration) {
+	span, ok := ctx.Value(spanKey{}).(trace.Span)
+	if !ok {
+		return
+	}
+
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	span.End()
+}
+
+func (h *Hooks) CacheHit(ctx context.Context, query string, hit bool) context.Context {
+	span, ok := ctx.Value(spanKey{}).(trace.Span)
+	if !ok {
+		return ctx
+	}
+
+	span.SetAttributes(attribute.Bool("db.sqlxcache.cache_hit", hit))
+	return ctx
+}
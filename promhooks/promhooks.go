@@ -0,0 +1,91 @@
+// Package promhooks provides a sqlxcache.Hooks implementation that records
+// query latency as a Prometheus histogram partitioned by whether the
+// statement cache was hit or missed, and cache-miss prepare latency as one
+// partitioned by whether the prepare succeeded.
+//
+// It lives in its own module so that importing it is the only way to pull
+// in the Prometheus client, the core sqlxcache module stays dependency-free.
+package promhooks
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Hooks is a sqlxcache.Hooks that observes query and prepare durations on
+// Prometheus histograms labeled by outcome ("hit"/"miss" for queries,
+// "ok"/"error" for prepares). Construct with New and register it with a
+// prometheus.Registerer.
+type Hooks struct {
+	queryDuration   *prometheus.HistogramVec
+	prepareDuration *prometheus.HistogramVec
+}
+
+// New returns a Hooks that reports under namespace/subsystem.
+func New(namespace, subsystem string) *Hooks {
+	return &Hooks{
+		queryDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "query_duration_seconds",
+			Help:      "Duration of queries run through sqlxcache, by statement-cache outcome.",
+		}, []string{"cache"}),
+		prepareDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "prepare_duration_seconds",
+			Help:      "Duration of statement-cache-miss prepares run through sqlxcache, by outcome.",
+		}, []string{"outcome"}),
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (h *Hooks) Describe(ch chan<- *prometheus.Desc) {
+	h.queryDuration.Describe(ch)
+	h.prepareDuration.Describe(ch)
+}
+
+// Collect implements prometheus.Collector.
+func (h *Hooks) Collect(ch chan<- prometheus.Metric) {
+	h.queryDuration.Collect(ch)
+	h.prepareDuration.Collect(ch)
+}
+
+func (h *Hooks) BeforeQuery(ctx context.Context, query string, args []interface{}) context.Context {
+	return ctx
+}
+
+func (h *Hooks) AfterQuery(ctx context.Context, query string, args []interface{}, err error, duration time.Duration) {
+	label := "miss"
+	if hit, _ := ctx.Value(cacheHitKey{}).(bool); hit {
+		label = "hit"
+	}
+
+	h.queryDuration.WithLabelValues(label).Observe(duration.Seconds())
+}
+
+func (h *Hooks) BeforePrepare(ctx context.Context, query string) context.Context {
+	return ctx
+}
+
+func (h *Hooks) AfterPrepare(ctx context.Context, query string, err error, duration time.Duration) {
+	outcome := "ok"
+	if err != nil {
+		outcome = "error"
+	}
+
+	h.prepareDuration.WithLabelValues(outcome).Observe(duration.Seconds())
+}
+
+type cacheHitKey struct{}
+
+// CacheHit stashes whether query was already prepared on ctx, so the
+// matching AfterQuery call (which receives this same ctx back from
+// sqlxcache) is attributed to the right cache label. Carrying the outcome
+// on the context rather than a query-keyed map avoids two concurrent
+// calls for the same query stepping on each other's outcome.
+func (h *Hooks) CacheHit(ctx context.Context, query string, hit bool) context.Context {
+	return context.WithValue(ctx, cacheHitKey{}, hit)
+}
@@ -0,0 +1,45 @@
+package sqlxcache
+
+import (
+	"context"
+	"math/rand"
+	"sync/atomic"
+)
+
+// LoadBalancer picks which of n replicas should serve the next read.
+type LoadBalancer interface {
+	// Next returns an index in [0, n).
+	Next(n int) int
+}
+
+// RoundRobinBalancer cycles through replicas in order. It is the default
+// balancer used by NewWithReplicas.
+type RoundRobinBalancer struct {
+	counter uint64
+}
+
+func (b *RoundRobinBalancer) Next(n int) int {
+	i := atomic.AddUint64(&b.counter, 1) - 1
+	return int(i % uint64(n))
+}
+
+// RandomBalancer picks a replica uniformly at random.
+type RandomBalancer struct{}
+
+func (RandomBalancer) Next(n int) int {
+	return rand.Intn(n)
+}
+
+type forceWriteKey struct{}
+
+// ForceWrite returns a context under which Cache's read methods route to
+// the primary instead of a replica. This is useful for read-your-writes
+// consistency, e.g. reading back a row immediately after writing it.
+func ForceWrite(ctx context.Context) context.Context {
+	return context.WithValue(ctx, forceWriteKey{}, true)
+}
+
+func forceWrite(ctx context.Context) bool {
+	forced, _ := ctx.Value(forceWriteKey{}).(bool)
+	return forced
+}
@@ -0,0 +1,84 @@
+package sqlxcache
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+)
+
+func TestRoundRobinBalancerCyclesInOrder(t *testing.T) {
+	b := &RoundRobinBalancer{}
+
+	const n = 3
+	got := make([]int, 6)
+	for i := range got {
+		got[i] = b.Next(n)
+	}
+
+	want := []int{0, 1, 2, 0, 1, 2}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Next(%d) call %d = %d, want %d", n, i, got[i], want[i])
+		}
+	}
+}
+
+func TestForceWriteRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	if forceWrite(ctx) {
+		t.Error("forceWrite(ctx) is true before ForceWrite was ever called on it")
+	}
+
+	ctx = ForceWrite(ctx)
+	if !forceWrite(ctx) {
+		t.Error("forceWrite(ForceWrite(ctx)) = false, want true")
+	}
+}
+
+func newFakeCache(t *testing.T, replicaCount int) *Cache {
+	t.Helper()
+
+	primary := sqlx.NewDb(newFakeSQLDB(t), "fakedriver")
+	c := New(primary)
+	for i := 0; i < replicaCount; i++ {
+		c.replicas = append(c.replicas, newNode(sqlx.NewDb(newFakeSQLDB(t), "fakedriver"), CacheOptions{}))
+	}
+
+	return c
+}
+
+func TestReadNodeContextWithNoReplicasUsesPrimary(t *testing.T) {
+	c := newFakeCache(t, 0)
+
+	if got := c.readNodeContext(context.Background()); got != c.primary {
+		t.Error("readNodeContext with no replicas did not return primary")
+	}
+}
+
+func TestReadNodeContextHonorsForceWrite(t *testing.T) {
+	c := newFakeCache(t, 2)
+
+	if got := c.readNodeContext(ForceWrite(context.Background())); got != c.primary {
+		t.Error("readNodeContext under ForceWrite did not return primary")
+	}
+}
+
+func TestReadNodeContextRoutesAcrossReplicas(t *testing.T) {
+	c := newFakeCache(t, 2)
+
+	seen := map[*node]bool{}
+	for i := 0; i < len(c.replicas); i++ {
+		n := c.readNodeContext(context.Background())
+		if n == c.primary {
+			t.Fatal("readNodeContext routed to primary despite available replicas")
+		}
+		seen[n] = true
+	}
+
+	for _, replica := range c.replicas {
+		if !seen[replica] {
+			t.Errorf("replica %p was never selected by the round-robin balancer", replica)
+		}
+	}
+}
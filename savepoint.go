@@ -0,0 +1,147 @@
+package sqlxcache
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+)
+
+// txTree is shared by a root Tx and every savepoint nested under it, so
+// that auto-generated savepoint names are unique across the whole tree.
+type txTree struct {
+	mu      sync.Mutex
+	counter int
+}
+
+func (t *txTree) nextSavepointName() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.counter++
+	return fmt.Sprintf("sp_%d", t.counter)
+}
+
+// Begin opens a SAVEPOINT rather than a real nested transaction, and
+// returns a child Tx scoped to it. The child shares tx's underlying
+// *sqlx.Tx and statement caches -- statements prepared inside the
+// savepoint remain valid after it is released, since PREPARE is
+// session-scoped, not transactional. This lets helper functions each
+// open their own transactional scope without knowing whether a
+// transaction is already open.
+func (tx *Tx) Begin() (*Tx, error) {
+	return tx.beginSavepoint(func(name string) error {
+		_, err := tx.tx.Exec(`SAVEPOINT ` + name)
+		return err
+	})
+}
+
+// BeginTx behaves like Begin. opts is accepted for symmetry with
+// Cache.BeginTx; a savepoint has no isolation level or read-only mode of
+// its own, so opts is otherwise unused.
+func (tx *Tx) BeginTx(ctx context.Context, opts *sql.TxOptions) (*Tx, error) {
+	return tx.beginSavepoint(func(name string) error {
+		_, err := tx.tx.ExecContext(ctx, `SAVEPOINT `+name)
+		return err
+	})
+}
+
+func (tx *Tx) beginSavepoint(exec func(name string) error) (*Tx, error) {
+	tx.mu.Lock()
+	done := tx.done
+	tx.mu.Unlock()
+	if done {
+		return nil, sql.ErrTxDone
+	}
+
+	name := tx.tree.nextSavepointName()
+	if err := exec(name); err != nil {
+		return nil, err
+	}
+
+	child := &Tx{
+		c:          tx.c,
+		tx:         tx.tx,
+		stmts:      tx.stmts,
+		namedStmts: tx.namedStmts,
+		tree:       tx.tree,
+		parent:     tx,
+		savepoint:  name,
+	}
+
+	tx.mu.Lock()
+	tx.children = append(tx.children, child)
+	tx.mu.Unlock()
+
+	return child, nil
+}
+
+// Commit commits the outermost Tx, or releases the savepoint opened by
+// Begin/BeginTx. It is idempotent, and invalidates every descendant
+// savepoint Tx: RELEASE SAVEPOINT also discards any savepoints nested
+// inside it on the database side, so once this is called, Commit/Rollback
+// on any Tx nested inside it becomes a no-op rather than sending a
+// RELEASE/ROLLBACK TO SAVEPOINT the database has already dropped.
+func (tx *Tx) Commit() error {
+	tx.mu.Lock()
+	if tx.done {
+		tx.mu.Unlock()
+		return nil
+	}
+	tx.done = true
+	children := tx.children
+	tx.children = nil
+	tx.mu.Unlock()
+
+	invalidateDescendants(children)
+
+	if tx.savepoint == "" {
+		return tx.tx.Commit()
+	}
+
+	_, err := tx.tx.Exec(`RELEASE SAVEPOINT ` + tx.savepoint)
+	return err
+}
+
+// Rollback rolls back the outermost Tx, or rolls back to the savepoint
+// opened by Begin/BeginTx. It is idempotent, and invalidates every
+// descendant savepoint Tx: once this is called, Commit/Rollback on any
+// Tx nested inside it becomes a no-op, since the database has already
+// discarded those savepoints.
+func (tx *Tx) Rollback() error {
+	tx.mu.Lock()
+	if tx.done {
+		tx.mu.Unlock()
+		return nil
+	}
+	tx.done = true
+	children := tx.children
+	tx.children = nil
+	tx.mu.Unlock()
+
+	invalidateDescendants(children)
+
+	if tx.savepoint == "" {
+		return tx.tx.Rollback()
+	}
+
+	_, err := tx.tx.Exec(`ROLLBACK TO SAVEPOINT ` + tx.savepoint)
+	return err
+}
+
+func invalidateDescendants(children []*Tx) {
+	for _, child := range children {
+		child.mu.Lock()
+		if child.done {
+			child.mu.Unlock()
+			continue
+		}
+
+		child.done = true
+		grandchildren := child.children
+		child.children = nil
+		child.mu.Unlock()
+
+		invalidateDescendants(grandchildren)
+	}
+}
@@ -0,0 +1,160 @@
+package sqlxcache
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// fakeDriver backs a *sql.DB with an in-memory connection that accepts any
+// Exec/Commit/Rollback as a no-op, so Tx.Commit/Rollback can be exercised
+// without a live database.
+type fakeDriver struct{}
+
+func (fakeDriver) Open(name string) (driver.Conn, error) {
+	return &fakeConn{}, nil
+}
+
+type fakeConn struct{}
+
+func (*fakeConn) Prepare(query string) (driver.Stmt, error) { return &fakeStmt{}, nil }
+func (*fakeConn) Close() error                              { return nil }
+func (*fakeConn) Begin() (driver.Tx, error)                 { return &fakeTx{}, nil }
+func (*fakeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	return driver.RowsAffected(0), nil
+}
+
+type fakeStmt struct{}
+
+func (*fakeStmt) Close() error                                    { return nil }
+func (*fakeStmt) NumInput() int                                   { return -1 }
+func (*fakeStmt) Exec(args []driver.Value) (driver.Result, error) { return driver.RowsAffected(0), nil }
+func (*fakeStmt) Query(args []driver.Value) (driver.Rows, error)  { return nil, sql.ErrNoRows }
+
+type fakeTx struct{}
+
+func (*fakeTx) Commit() error   { return nil }
+func (*fakeTx) Rollback() error { return nil }
+
+func newFakeSQLDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	return sql.OpenDB(fakeConnector{})
+}
+
+func newFakeSqlxTx(t *testing.T) *sqlx.Tx {
+	t.Helper()
+
+	sqlTx, err := newFakeSQLDB(t).Begin()
+	if err != nil {
+		t.Fatalf("begin fake tx: %v", err)
+	}
+
+	return &sqlx.Tx{Tx: sqlTx}
+}
+
+type fakeConnector struct{}
+
+func (fakeConnector) Connect(ctx context.Context) (driver.Conn, error) { return &fakeConn{}, nil }
+func (fakeConnector) Driver() driver.Driver                            { return fakeDriver{} }
+
+func newTestTx(t *testing.T) *Tx {
+	return &Tx{
+		tx:         newFakeSqlxTx(t),
+		stmts:      map[string]*sqlx.Stmt{},
+		namedStmts: map[string]*sqlx.NamedStmt{},
+		tree:       &txTree{},
+	}
+}
+
+func newTestSavepoint(parent *Tx) *Tx {
+	child := &Tx{
+		c:          parent.c,
+		tx:         parent.tx,
+		stmts:      parent.stmts,
+		namedStmts: parent.namedStmts,
+		tree:       parent.tree,
+		parent:     parent,
+		savepoint:  parent.tree.nextSavepointName(),
+	}
+
+	parent.mu.Lock()
+	parent.children = append(parent.children, child)
+	parent.mu.Unlock()
+
+	return child
+}
+
+func TestTxCommitIdempotent(t *testing.T) {
+	tx := newTestTx(t)
+
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("first Commit: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("second Commit should be a no-op, got: %v", err)
+	}
+}
+
+func TestTxRollbackIdempotent(t *testing.T) {
+	tx := newTestTx(t)
+
+	if err := tx.Rollback(); err != nil {
+		t.Fatalf("first Rollback: %v", err)
+	}
+	if err := tx.Rollback(); err != nil {
+		t.Fatalf("second Rollback should be a no-op, got: %v", err)
+	}
+}
+
+func TestTxRollbackInvalidatesDescendants(t *testing.T) {
+	root := newTestTx(t)
+	child := newTestSavepoint(root)
+	grandchild := newTestSavepoint(child)
+
+	if err := root.Rollback(); err != nil {
+		t.Fatalf("Rollback: %v", err)
+	}
+
+	if !child.done {
+		t.Error("child was not invalidated by parent Rollback")
+	}
+	if !grandchild.done {
+		t.Error("grandchild was not invalidated by parent Rollback")
+	}
+
+	// Invalidated descendants must themselves be idempotent no-ops.
+	if err := child.Commit(); err != nil {
+		t.Errorf("Commit on an invalidated child returned an error: %v", err)
+	}
+	if err := grandchild.Rollback(); err != nil {
+		t.Errorf("Rollback on an invalidated grandchild returned an error: %v", err)
+	}
+}
+
+func TestTxCommitInvalidatesDescendants(t *testing.T) {
+	root := newTestTx(t)
+	child := newTestSavepoint(root)
+	grandchild := newTestSavepoint(child)
+
+	if err := root.Commit(); err != nil {
+		t.Fatalf("Commit: %v", err)
+	}
+
+	if !child.done {
+		t.Error("child was not invalidated by parent Commit")
+	}
+	if !grandchild.done {
+		t.Error("grandchild was not invalidated by parent Commit")
+	}
+
+	if err := child.Commit(); err != nil {
+		t.Errorf("Commit on an invalidated child returned an error: %v", err)
+	}
+	if err := grandchild.Rollback(); err != nil {
+		t.Errorf("Rollback on an invalidated grandchild returned an error: %v", err)
+	}
+}
@@ -8,91 +8,143 @@ import (
 	"github.com/jmoiron/sqlx"
 )
 
-type Cache struct {
-	db                        *sqlx.DB
-	stmtsLock, namedStmtsLock sync.Mutex
-	stmts                     map[string]*sqlx.Stmt
-	namedStmts                map[string]*sqlx.NamedStmt
+// node wraps a single *sqlx.DB (the primary or one replica) along with the
+// prepared-statement caches bound to it. A *sqlx.Stmt is only valid against
+// the connection pool it was prepared on, so each node needs its own cache.
+type node struct {
+	db         *sqlx.DB
+	stmts      *lruCache
+	namedStmts *lruCache
 }
 
-func New(db *sqlx.DB) *Cache {
-	return &Cache{
+func newNode(db *sqlx.DB, opts CacheOptions) *node {
+	return &node{
 		db:         db,
-		stmts:      map[string]*sqlx.Stmt{},
-		namedStmts: map[string]*sqlx.NamedStmt{},
+		stmts:      newLRUCache(opts.MaxStmts),
+		namedStmts: newLRUCache(opts.MaxNamedStmts),
 	}
 }
 
-func (c *Cache) stmt(query string) (*sqlx.Stmt, error) {
-	c.stmtsLock.Lock()
-	defer c.stmtsLock.Unlock()
-
-	value, ok := c.stmts[query]
-	if ok {
-		return value, nil
+func (n *node) stmtContext(ctx context.Context, hooks Hooks, query string) (*stmtHandle, context.Context, error) {
+	entry, ctx, err := acquire(ctx, hooks, n.stmts, query, func() (closer, error) {
+		return n.db.PreparexContext(ctx, query)
+	})
+	if err != nil {
+		return nil, ctx, err
 	}
 
-	stmt, err := c.db.Preparex(query)
+	return &stmtHandle{cache: n.stmts, entry: entry, Stmt: entry.value.(*sqlx.Stmt)}, ctx, nil
+}
+
+func (n *node) namedStmtContext(ctx context.Context, hooks Hooks, query string) (*namedStmtHandle, context.Context, error) {
+	entry, ctx, err := acquire(ctx, hooks, n.namedStmts, query, func() (closer, error) {
+		return n.db.PrepareNamedContext(ctx, query)
+	})
 	if err != nil {
-		return nil, err
+		return nil, ctx, err
 	}
 
-	c.stmts[query] = stmt
-	return stmt, nil
+	return &namedStmtHandle{cache: n.namedStmts, entry: entry, Stmt: entry.value.(*sqlx.NamedStmt)}, ctx, nil
 }
 
-func (c *Cache) stmtContext(ctx context.Context, query string) (*sqlx.Stmt, error) {
-	c.stmtsLock.Lock()
-	defer c.stmtsLock.Unlock()
-
-	value, ok := c.stmts[query]
-	if ok {
-		return value, nil
+func (n *node) close() error {
+	err := n.stmts.closeAll()
+	if namedErr := n.namedStmts.closeAll(); err == nil {
+		err = namedErr
 	}
 
-	stmt, err := c.db.PreparexContext(ctx, query)
-	if err != nil {
-		return nil, err
+	if dbErr := n.db.Close(); err == nil {
+		err = dbErr
 	}
 
-	c.stmts[query] = stmt
-	return stmt, nil
+	return err
 }
 
-func (c *Cache) namedStmt(query string) (*sqlx.NamedStmt, error) {
-	c.namedStmtsLock.Lock()
-	defer c.namedStmtsLock.Unlock()
+// Cache wraps a *sqlx.DB primary and an optional pool of read replicas,
+// caching prepared statements per underlying connection pool.
+type Cache struct {
+	primary           *node
+	replicas          []*node
+	balancer          LoadBalancer
+	inExpansionBucket bool
+	hooks             Hooks
+}
 
-	value, ok := c.namedStmts[query]
-	if ok {
-		return value, nil
+// New wraps db in a Cache. By default the statement caches are unbounded;
+// pass a CacheOptions to bound them.
+func New(db *sqlx.DB, opts ...CacheOptions) *Cache {
+	options := resolveCacheOptions(opts)
+	hooks := options.Hooks
+	if hooks == nil {
+		hooks = noopHooks{}
 	}
 
-	namedStmt, err := c.db.PrepareNamed(query)
-	if err != nil {
-		return nil, err
+	return &Cache{
+		primary:           newNode(db, options),
+		balancer:          &RoundRobinBalancer{},
+		inExpansionBucket: options.InExpansionBucket,
+		hooks:             hooks,
 	}
+}
 
-	c.namedStmts[query] = namedStmt
-	return namedStmt, nil
+// NewWithReplicas returns a Cache that sends writes to primary and
+// load-balances reads across replicas (falling back to primary when no
+// replicas are given). Use SetLoadBalancer to pick a different strategy
+// than the default round-robin, and SetCacheOptions to bound the
+// statement caches of primary and every replica.
+func NewWithReplicas(primary *sqlx.DB, replicas ...*sqlx.DB) *Cache {
+	c := New(primary)
+	for _, replica := range replicas {
+		c.replicas = append(c.replicas, newNode(replica, CacheOptions{}))
+	}
+
+	return c
 }
 
-func (c *Cache) namedStmtContext(ctx context.Context, query string) (*sqlx.NamedStmt, error) {
-	c.namedStmtsLock.Lock()
-	defer c.namedStmtsLock.Unlock()
+// SetLoadBalancer sets the strategy used to pick a replica for read
+// queries. It returns c so it can be chained onto NewWithReplicas.
+func (c *Cache) SetLoadBalancer(balancer LoadBalancer) *Cache {
+	c.balancer = balancer
+	return c
+}
 
-	value, ok := c.namedStmts[query]
-	if ok {
-		return value, nil
+// SetCacheOptions (re-)bounds the statement caches of the primary and
+// every replica. It returns c so it can be chained onto NewWithReplicas.
+// MaxStmts/MaxNamedStmts always take opts' value (0 means unbounded,
+// same as their zero-value meaning elsewhere), but Hooks and
+// InExpansionBucket are merged in rather than replaced: a nil Hooks or a
+// false InExpansionBucket leaves whatever New (or an earlier
+// SetCacheOptions call) already set. This lets NewWithReplicas(...).
+// SetCacheOptions(CacheOptions{MaxStmts: N}) bound replica caches without
+// silently clearing hooks configured via New.
+func (c *Cache) SetCacheOptions(opts CacheOptions) *Cache {
+	for _, n := range c.allNodes() {
+		n.stmts.setMax(opts.MaxStmts)
+		n.namedStmts.setMax(opts.MaxNamedStmts)
 	}
 
-	namedStmt, err := c.db.PrepareNamedContext(ctx, query)
-	if err != nil {
-		return nil, err
+	if opts.InExpansionBucket {
+		c.inExpansionBucket = true
+	}
+	if opts.Hooks != nil {
+		c.hooks = opts.Hooks
+	}
+
+	return c
+}
+
+func (c *Cache) allNodes() []*node {
+	return append([]*node{c.primary}, c.replicas...)
+}
+
+// readNodeContext picks the node a read should run against, honoring
+// ForceWrite(ctx) for read-your-writes consistency.
+func (c *Cache) readNodeContext(ctx context.Context) *node {
+	if len(c.replicas) == 0 || forceWrite(ctx) {
+		return c.primary
 	}
 
-	c.namedStmts[query] = namedStmt
-	return namedStmt, nil
+	return c.replicas[c.balancer.Next(len(c.replicas))]
 }
 
 func Open(driverName, dataSourceName string) (*Cache, error) {
@@ -104,15 +156,27 @@ func Open(driverName, dataSourceName string) (*Cache, error) {
 	return New(db), nil
 }
 
+// Tx wraps a *sqlx.Tx together with a tx-local statement cache. A Tx
+// obtained from Begin/BeginTx on a savepoint-nested Tx (see savepoint.go)
+// shares its parent's underlying *sqlx.Tx and statement caches, and only
+// differs in how Commit/Rollback are implemented.
 type Tx struct {
 	c          *Cache
 	tx         *sqlx.Tx
 	stmts      map[string]*sqlx.Stmt
 	namedStmts map[string]*sqlx.NamedStmt
+
+	tree      *txTree
+	parent    *Tx
+	savepoint string
+
+	mu       sync.Mutex
+	done     bool
+	children []*Tx
 }
 
 func (c *Cache) Begin() (*Tx, error) {
-	tx, err := c.db.Beginx()
+	tx, err := c.primary.db.Beginx()
 	if err != nil {
 		return nil, err
 	}
@@ -122,11 +186,12 @@ func (c *Cache) Begin() (*Tx, error) {
 		tx:         tx,
 		stmts:      map[string]*sqlx.Stmt{},
 		namedStmts: map[string]*sqlx.NamedStmt{},
+		tree:       &txTree{},
 	}, nil
 }
 
 func (c *Cache) BeginTx(ctx context.Context, opts *sql.TxOptions) (*Tx, error) {
-	tx, err := c.db.BeginTxx(ctx, opts)
+	tx, err := c.primary.db.BeginTxx(ctx, opts)
 	if err != nil {
 		return nil, err
 	}
@@ -136,517 +201,485 @@ func (c *Cache) BeginTx(ctx context.Context, opts *sql.TxOptions) (*Tx, error) {
 		tx:         tx,
 		stmts:      map[string]*sqlx.Stmt{},
 		namedStmts: map[string]*sqlx.NamedStmt{},
+		tree:       &txTree{},
 	}, nil
 }
 
-func (tx *Tx) stmt(query string) (*sqlx.Stmt, error) {
+// stmtContext returns the tx-bound statement for query along with the
+// context CacheHit attached to ctx, so the caller's AfterQuery reports
+// the right hit/miss outcome. On the tx-local cache's fast path (query
+// already bound to this tx) no prepare happens, but that is itself a
+// cache hit -- query was already in the statement cache, just one layer
+// up from node's lruCache -- so CacheHit is still reported.
+func (tx *Tx) stmtContext(ctx context.Context, query string) (*sqlx.Stmt, context.Context, error) {
 	stmt, ok := tx.stmts[query]
 	if ok {
-		return stmt, nil
+		return stmt, tx.c.hooks.CacheHit(ctx, query, true), nil
 	}
 
-	cachedStmt, err := tx.c.stmt(query)
+	cachedStmt, ctx, err := tx.c.primary.stmtContext(ctx, tx.c.hooks, query)
 	if err != nil {
-		return nil, err
+		return nil, ctx, err
 	}
+	defer cachedStmt.Release()
 
-	stmt = tx.tx.Stmtx(cachedStmt)
+	stmt = tx.tx.StmtxContext(ctx, cachedStmt.Stmt)
 	tx.stmts[query] = stmt
-	return stmt, nil
+	return stmt, ctx, nil
 }
 
-func (tx *Tx) stmtContext(ctx context.Context, query string) (*sqlx.Stmt, error) {
-	stmt, ok := tx.stmts[query]
-	if ok {
-		return stmt, nil
-	}
-
-	cachedStmt, err := tx.c.stmtContext(ctx, query)
-	if err != nil {
-		return nil, err
-	}
-
-	stmt = tx.tx.StmtxContext(ctx, cachedStmt)
-	tx.stmts[query] = stmt
-	return stmt, nil
-}
-
-func (tx *Tx) namedStmt(query string) (*sqlx.NamedStmt, error) {
-	namedStmt, ok := tx.namedStmts[query]
-	if ok {
-		return namedStmt, nil
-	}
-
-	cachedNamedStmt, err := tx.c.namedStmt(query)
-	if err != nil {
-		return nil, err
-	}
-
-	namedStmt = tx.tx.NamedStmt(cachedNamedStmt)
-	tx.namedStmts[query] = namedStmt
-	return namedStmt, nil
-}
-
-func (tx *Tx) namedStmtContext(ctx context.Context, query string) (*sqlx.NamedStmt, error) {
+// namedStmtContext mirrors stmtContext for named statements.
+func (tx *Tx) namedStmtContext(ctx context.Context, query string) (*sqlx.NamedStmt, context.Context, error) {
 	namedStmt, ok := tx.namedStmts[query]
 	if ok {
-		return namedStmt, nil
+		return namedStmt, tx.c.hooks.CacheHit(ctx, query, true), nil
 	}
 
-	cachedNamedStmt, err := tx.c.namedStmtContext(ctx, query)
+	cachedNamedStmt, ctx, err := tx.c.primary.namedStmtContext(ctx, tx.c.hooks, query)
 	if err != nil {
-		return nil, err
+		return nil, ctx, err
 	}
+	defer cachedNamedStmt.Release()
 
-	namedStmt = tx.tx.NamedStmtContext(ctx, cachedNamedStmt)
+	namedStmt = tx.tx.NamedStmtContext(ctx, cachedNamedStmt.Stmt)
 	tx.namedStmts[query] = namedStmt
-	return namedStmt, nil
+	return namedStmt, ctx, nil
 }
 
 func (tx *Tx) Exec(query string, args ...interface{}) (sql.Result, error) {
-	stmt, err := tx.stmt(query)
-	if err != nil {
-		return nil, err
-	}
-
-	return stmt.Exec(args...)
+	return tx.ExecContext(context.Background(), query, args...)
 }
 
 func (tx *Tx) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
-	stmt, err := tx.stmtContext(ctx, query)
+	ctx, start := tx.c.beforeQuery(ctx, query, args)
+	stmt, ctx, err := tx.stmtContext(ctx, query)
 	if err != nil {
+		tx.c.afterQuery(ctx, query, args, start, err)
 		return nil, err
 	}
 
-	return stmt.ExecContext(ctx, args...)
+	result, err := stmt.ExecContext(ctx, args...)
+	tx.c.afterQuery(ctx, query, args, start, err)
+	return result, err
 }
 
 func (tx *Tx) NamedExec(query string, arg interface{}) (sql.Result, error) {
-	namedStmt, err := tx.namedStmt(query)
-	if err != nil {
-		return nil, err
-	}
-
-	return namedStmt.Exec(arg)
+	return tx.NamedExecContext(context.Background(), query, arg)
 }
 
 func (tx *Tx) NamedExecContext(ctx context.Context, query string, arg interface{}) (sql.Result, error) {
-	namedStmt, err := tx.namedStmtContext(ctx, query)
+	ctx, start := tx.c.beforeQuery(ctx, query, []interface{}{arg})
+	namedStmt, ctx, err := tx.namedStmtContext(ctx, query)
 	if err != nil {
+		tx.c.afterQuery(ctx, query, []interface{}{arg}, start, err)
 		return nil, err
 	}
 
-	return namedStmt.ExecContext(ctx, arg)
+	result, err := namedStmt.ExecContext(ctx, arg)
+	tx.c.afterQuery(ctx, query, []interface{}{arg}, start, err)
+	return result, err
 }
 
 func (tx *Tx) Query(query string, args ...interface{}) (*sql.Rows, error) {
-	stmt, err := tx.stmt(query)
-	if err != nil {
-		return nil, err
-	}
-
-	return stmt.Query(args...)
+	return tx.QueryContext(context.Background(), query, args...)
 }
 
 func (tx *Tx) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
-	stmt, err := tx.stmtContext(ctx, query)
+	ctx, start := tx.c.beforeQuery(ctx, query, args)
+	stmt, ctx, err := tx.stmtContext(ctx, query)
 	if err != nil {
+		tx.c.afterQuery(ctx, query, args, start, err)
 		return nil, err
 	}
 
-	return stmt.QueryContext(ctx, args...)
+	rows, err := stmt.QueryContext(ctx, args...)
+	tx.c.afterQuery(ctx, query, args, start, err)
+	return rows, err
 }
 
 func (tx *Tx) NamedQuery(query string, arg interface{}) (*sql.Rows, error) {
-	namedStmt, err := tx.namedStmt(query)
-	if err != nil {
-		return nil, err
-	}
-
-	return namedStmt.Query(arg)
+	return tx.NamedQueryContext(context.Background(), query, arg)
 }
 
 func (tx *Tx) NamedQueryContext(ctx context.Context, query string, arg interface{}) (*sql.Rows, error) {
-	namedStmt, err := tx.namedStmtContext(ctx, query)
+	ctx, start := tx.c.beforeQuery(ctx, query, []interface{}{arg})
+	namedStmt, ctx, err := tx.namedStmtContext(ctx, query)
 	if err != nil {
+		tx.c.afterQuery(ctx, query, []interface{}{arg}, start, err)
 		return nil, err
 	}
 
-	return namedStmt.QueryContext(ctx, arg)
+	rows, err := namedStmt.QueryContext(ctx, arg)
+	tx.c.afterQuery(ctx, query, []interface{}{arg}, start, err)
+	return rows, err
 }
 
 func (tx *Tx) Queryx(query string, args ...interface{}) (*sqlx.Rows, error) {
-	stmt, err := tx.stmt(query)
-	if err != nil {
-		return nil, err
-	}
-
-	return stmt.Queryx(args...)
+	return tx.QueryxContext(context.Background(), query, args...)
 }
 
 func (tx *Tx) QueryxContext(ctx context.Context, query string, args ...interface{}) (*sqlx.Rows, error) {
-	stmt, err := tx.stmtContext(ctx, query)
+	ctx, start := tx.c.beforeQuery(ctx, query, args)
+	stmt, ctx, err := tx.stmtContext(ctx, query)
 	if err != nil {
+		tx.c.afterQuery(ctx, query, args, start, err)
 		return nil, err
 	}
 
-	return stmt.QueryxContext(ctx, args...)
+	rows, err := stmt.QueryxContext(ctx, args...)
+	tx.c.afterQuery(ctx, query, args, start, err)
+	return rows, err
 }
 
 func (tx *Tx) NamedQueryx(query string, arg interface{}) (*sqlx.Rows, error) {
-	namedStmt, err := tx.namedStmt(query)
-	if err != nil {
-		return nil, err
-	}
-
-	return namedStmt.Queryx(arg)
+	return tx.NamedQueryxContext(context.Background(), query, arg)
 }
 
 func (tx *Tx) NamedQueryxContext(ctx context.Context, query string, arg interface{}) (*sqlx.Rows, error) {
-	namedStmt, err := tx.namedStmtContext(ctx, query)
+	ctx, start := tx.c.beforeQuery(ctx, query, []interface{}{arg})
+	namedStmt, ctx, err := tx.namedStmtContext(ctx, query)
 	if err != nil {
+		tx.c.afterQuery(ctx, query, []interface{}{arg}, start, err)
 		return nil, err
 	}
 
-	return namedStmt.QueryxContext(ctx, arg)
+	rows, err := namedStmt.QueryxContext(ctx, arg)
+	tx.c.afterQuery(ctx, query, []interface{}{arg}, start, err)
+	return rows, err
 }
 
 func (tx *Tx) QueryxRow(query string, args ...interface{}) (*sqlx.Row, error) {
-	stmt, err := tx.stmt(query)
-	if err != nil {
-		return nil, err
-	}
-
-	return stmt.QueryRowx(args...), nil
+	return tx.QueryRowxContext(context.Background(), query, args...)
 }
 
 func (tx *Tx) QueryRowxContext(ctx context.Context, query string, args ...interface{}) (*sqlx.Row, error) {
-	stmt, err := tx.stmtContext(ctx, query)
+	ctx, start := tx.c.beforeQuery(ctx, query, args)
+	stmt, ctx, err := tx.stmtContext(ctx, query)
 	if err != nil {
+		tx.c.afterQuery(ctx, query, args, start, err)
 		return nil, err
 	}
 
-	return stmt.QueryRowxContext(ctx, args...), nil
+	row := stmt.QueryRowxContext(ctx, args...)
+	tx.c.afterQuery(ctx, query, args, start, nil)
+	return row, nil
 }
 
 func (tx *Tx) NamedQueryRow(query string, arg interface{}) (*sqlx.Row, error) {
-	namedStmt, err := tx.namedStmt(query)
-	if err != nil {
-		return nil, err
-	}
-
-	return namedStmt.QueryRow(arg), nil
+	return tx.NamedQueryRowContext(context.Background(), query, arg)
 }
 
 func (tx *Tx) NamedQueryRowContext(ctx context.Context, query string, arg interface{}) (*sqlx.Row, error) {
-	namedStmt, err := tx.namedStmtContext(ctx, query)
+	ctx, start := tx.c.beforeQuery(ctx, query, []interface{}{arg})
+	namedStmt, ctx, err := tx.namedStmtContext(ctx, query)
 	if err != nil {
+		tx.c.afterQuery(ctx, query, []interface{}{arg}, start, err)
 		return nil, err
 	}
 
-	return namedStmt.QueryRowContext(ctx, arg), nil
+	row := namedStmt.QueryRowContext(ctx, arg)
+	tx.c.afterQuery(ctx, query, []interface{}{arg}, start, nil)
+	return row, nil
 }
 
 func (tx *Tx) Get(dest interface{}, query string, args ...interface{}) error {
-	stmt, err := tx.stmt(query)
-	if err != nil {
-		return err
-	}
-
-	return stmt.Get(dest, args...)
+	return tx.GetContext(context.Background(), dest, query, args...)
 }
 
 func (tx *Tx) GetContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
-	stmt, err := tx.stmtContext(ctx, query)
+	ctx, start := tx.c.beforeQuery(ctx, query, args)
+	stmt, ctx, err := tx.stmtContext(ctx, query)
 	if err != nil {
+		tx.c.afterQuery(ctx, query, args, start, err)
 		return err
 	}
 
-	return stmt.GetContext(ctx, dest, args...)
+	err = stmt.GetContext(ctx, dest, args...)
+	tx.c.afterQuery(ctx, query, args, start, err)
+	return err
 }
 
 func (tx *Tx) NamedGet(dest interface{}, query string, arg interface{}) error {
-	namedStmt, err := tx.namedStmt(query)
-	if err != nil {
-		return err
-	}
-
-	return tx.tx.NamedStmt(namedStmt).Get(dest, arg)
+	return tx.NamedGetContext(context.Background(), dest, query, arg)
 }
 
 func (tx *Tx) NamedGetContext(ctx context.Context, dest interface{}, query string, arg interface{}) error {
-	namedStmt, err := tx.namedStmtContext(ctx, query)
+	ctx, start := tx.c.beforeQuery(ctx, query, []interface{}{arg})
+	namedStmt, ctx, err := tx.namedStmtContext(ctx, query)
 	if err != nil {
+		tx.c.afterQuery(ctx, query, []interface{}{arg}, start, err)
 		return err
 	}
 
-	return tx.tx.NamedStmtContext(ctx, namedStmt).GetContext(ctx, dest, arg)
+	err = tx.tx.NamedStmtContext(ctx, namedStmt).GetContext(ctx, dest, arg)
+	tx.c.afterQuery(ctx, query, []interface{}{arg}, start, err)
+	return err
 }
 
 func (tx *Tx) Select(dest interface{}, query string, args ...interface{}) error {
-	stmt, err := tx.stmt(query)
-	if err != nil {
-		return err
-	}
-
-	return stmt.Select(dest, args...)
+	return tx.SelectContext(context.Background(), dest, query, args...)
 }
 
 func (tx *Tx) SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
-	stmt, err := tx.stmtContext(ctx, query)
+	ctx, start := tx.c.beforeQuery(ctx, query, args)
+	stmt, ctx, err := tx.stmtContext(ctx, query)
 	if err != nil {
+		tx.c.afterQuery(ctx, query, args, start, err)
 		return err
 	}
 
-	return stmt.SelectContext(ctx, dest, args...)
+	err = stmt.SelectContext(ctx, dest, args...)
+	tx.c.afterQuery(ctx, query, args, start, err)
+	return err
 }
 
 func (tx *Tx) NamedSelect(dest interface{}, query string, arg interface{}) error {
-	namedStmt, err := tx.namedStmt(query)
-	if err != nil {
-		return err
-	}
-
-	return tx.tx.NamedStmt(namedStmt).Select(dest, arg)
+	return tx.NamedSelectContext(context.Background(), dest, query, arg)
 }
 
 func (tx *Tx) NamedSelectContext(ctx context.Context, dest interface{}, query string, arg interface{}) error {
-	namedStmt, err := tx.namedStmtContext(ctx, query)
+	ctx, start := tx.c.beforeQuery(ctx, query, []interface{}{arg})
+	namedStmt, ctx, err := tx.namedStmtContext(ctx, query)
 	if err != nil {
+		tx.c.afterQuery(ctx, query, []interface{}{arg}, start, err)
 		return err
 	}
 
-	return tx.tx.NamedStmtContext(ctx, namedStmt).SelectContext(ctx, dest, arg)
-}
-
-func (tx *Tx) Rollback() error {
-	return tx.tx.Rollback()
-}
-
-func (tx *Tx) Commit() error {
-	return tx.tx.Commit()
+	err = tx.tx.NamedStmtContext(ctx, namedStmt).SelectContext(ctx, dest, arg)
+	tx.c.afterQuery(ctx, query, []interface{}{arg}, start, err)
+	return err
 }
 
 func (c *Cache) Exec(query string, args ...interface{}) (sql.Result, error) {
-	stmt, err := c.stmt(query)
-	if err != nil {
-		return nil, err
-	}
-
-	return stmt.Exec(args...)
+	return c.ExecContext(context.Background(), query, args...)
 }
 
 func (c *Cache) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
-	stmt, err := c.stmtContext(ctx, query)
+	ctx, start := c.beforeQuery(ctx, query, args)
+	stmt, ctx, err := c.primary.stmtContext(ctx, c.hooks, query)
 	if err != nil {
+		c.afterQuery(ctx, query, args, start, err)
 		return nil, err
 	}
+	defer stmt.Release()
 
-	return stmt.ExecContext(ctx, args...)
+	result, err := stmt.Stmt.ExecContext(ctx, args...)
+	c.afterQuery(ctx, query, args, start, err)
+	return result, err
 }
 
 func (c *Cache) NamedExec(query string, arg interface{}) (sql.Result, error) {
-	namedStmt, err := c.namedStmt(query)
-	if err != nil {
-		return nil, err
-	}
-
-	return namedStmt.Exec(arg)
+	return c.NamedExecContext(context.Background(), query, arg)
 }
 
 func (c *Cache) NamedExecContext(ctx context.Context, query string, arg interface{}) (sql.Result, error) {
-	namedStmt, err := c.namedStmtContext(ctx, query)
+	ctx, start := c.beforeQuery(ctx, query, []interface{}{arg})
+	namedStmt, ctx, err := c.primary.namedStmtContext(ctx, c.hooks, query)
 	if err != nil {
+		c.afterQuery(ctx, query, []interface{}{arg}, start, err)
 		return nil, err
 	}
+	defer namedStmt.Release()
 
-	return namedStmt.ExecContext(ctx, arg)
+	result, err := namedStmt.Stmt.ExecContext(ctx, arg)
+	c.afterQuery(ctx, query, []interface{}{arg}, start, err)
+	return result, err
 }
 
 func (c *Cache) QueryRow(query string, args ...interface{}) (*sql.Row, error) {
-	stmt, err := c.stmt(query)
-	if err != nil {
-		return nil, err
-	}
-
-	return stmt.QueryRow(args...), nil
+	return c.QueryRowContext(context.Background(), query, args...)
 }
 
 func (c *Cache) QueryRowContext(ctx context.Context, query string, args ...interface{}) (*sql.Row, error) {
-	stmt, err := c.stmtContext(ctx, query)
+	ctx, start := c.beforeQuery(ctx, query, args)
+	stmt, ctx, err := c.readNodeContext(ctx).stmtContext(ctx, c.hooks, query)
 	if err != nil {
+		c.afterQuery(ctx, query, args, start, err)
 		return nil, err
 	}
+	defer stmt.Release()
 
-	return stmt.QueryRowContext(ctx, args...), nil
+	row := stmt.Stmt.QueryRowContext(ctx, args...)
+	c.afterQuery(ctx, query, args, start, nil)
+	return row, nil
 }
 
 func (c *Cache) QueryxRow(query string, args ...interface{}) (*sqlx.Row, error) {
-	stmt, err := c.stmt(query)
-	if err != nil {
-		return nil, err
-	}
-
-	return stmt.QueryRowx(args...), nil
+	return c.QueryRowxContext(context.Background(), query, args...)
 }
 
 func (c *Cache) QueryRowxContext(ctx context.Context, query string, args ...interface{}) (*sqlx.Row, error) {
-	stmt, err := c.stmtContext(ctx, query)
+	ctx, start := c.beforeQuery(ctx, query, args)
+	stmt, ctx, err := c.readNodeContext(ctx).stmtContext(ctx, c.hooks, query)
 	if err != nil {
+		c.afterQuery(ctx, query, args, start, err)
 		return nil, err
 	}
+	defer stmt.Release()
 
-	return stmt.QueryRowxContext(ctx, args...), nil
+	row := stmt.Stmt.QueryRowxContext(ctx, args...)
+	c.afterQuery(ctx, query, args, start, nil)
+	return row, nil
 }
 
 func (c *Cache) NamedQueryRow(query string, arg interface{}) (*sqlx.Row, error) {
-	namedStmt, err := c.namedStmt(query)
-	if err != nil {
-		return nil, err
-	}
-
-	return namedStmt.QueryRow(arg), nil
+	return c.NamedQueryRowContext(context.Background(), query, arg)
 }
 
 func (c *Cache) NamedQueryRowContext(ctx context.Context, query string, arg interface{}) (*sqlx.Row, error) {
-	namedStmt, err := c.namedStmtContext(ctx, query)
+	ctx, start := c.beforeQuery(ctx, query, []interface{}{arg})
+	namedStmt, ctx, err := c.readNodeContext(ctx).namedStmtContext(ctx, c.hooks, query)
 	if err != nil {
+		c.afterQuery(ctx, query, []interface{}{arg}, start, err)
 		return nil, err
 	}
+	defer namedStmt.Release()
 
-	return namedStmt.QueryRowContext(ctx, arg), nil
+	row := namedStmt.Stmt.QueryRowContext(ctx, arg)
+	c.afterQuery(ctx, query, []interface{}{arg}, start, nil)
+	return row, nil
 }
 
 func (c *Cache) Query(query string, arg interface{}) (*sql.Rows, error) {
-	stmt, err := c.stmt(query)
-	if err != nil {
-		return nil, err
-	}
-
-	return stmt.Query(arg)
+	return c.QueryContext(context.Background(), query, arg)
 }
 
 func (c *Cache) QueryContext(ctx context.Context, query string, arg interface{}) (*sql.Rows, error) {
-	stmt, err := c.stmtContext(ctx, query)
+	ctx, start := c.beforeQuery(ctx, query, []interface{}{arg})
+	stmt, ctx, err := c.readNodeContext(ctx).stmtContext(ctx, c.hooks, query)
 	if err != nil {
+		c.afterQuery(ctx, query, []interface{}{arg}, start, err)
 		return nil, err
 	}
+	defer stmt.Release()
 
-	return stmt.QueryContext(ctx, arg)
+	rows, err := stmt.Stmt.QueryContext(ctx, arg)
+	c.afterQuery(ctx, query, []interface{}{arg}, start, err)
+	return rows, err
 }
 
 func (c *Cache) NamedQuery(query string, arg interface{}) (*sqlx.Rows, error) {
-	namedStmt, err := c.namedStmt(query)
-	if err != nil {
-		return nil, err
-	}
-
-	return namedStmt.Queryx(arg)
+	return c.NamedQueryContext(context.Background(), query, arg)
 }
 
 func (c *Cache) NamedQueryContext(ctx context.Context, query string, arg interface{}) (*sqlx.Rows, error) {
-	namedStmt, err := c.namedStmtContext(ctx, query)
+	ctx, start := c.beforeQuery(ctx, query, []interface{}{arg})
+	namedStmt, ctx, err := c.readNodeContext(ctx).namedStmtContext(ctx, c.hooks, query)
 	if err != nil {
+		c.afterQuery(ctx, query, []interface{}{arg}, start, err)
 		return nil, err
 	}
+	defer namedStmt.Release()
 
-	return namedStmt.QueryxContext(ctx, arg)
+	rows, err := namedStmt.Stmt.QueryxContext(ctx, arg)
+	c.afterQuery(ctx, query, []interface{}{arg}, start, err)
+	return rows, err
 }
 
 func (c *Cache) Queryx(query string, args ...interface{}) (*sqlx.Rows, error) {
-	stmt, err := c.stmt(query)
-	if err != nil {
-		return nil, err
-	}
-
-	return stmt.Queryx(args...)
+	return c.QueryxContext(context.Background(), query, args...)
 }
 
 func (c *Cache) QueryxContext(ctx context.Context, query string, args ...interface{}) (*sqlx.Rows, error) {
-	stmt, err := c.stmtContext(ctx, query)
+	ctx, start := c.beforeQuery(ctx, query, args)
+	stmt, ctx, err := c.readNodeContext(ctx).stmtContext(ctx, c.hooks, query)
 	if err != nil {
+		c.afterQuery(ctx, query, args, start, err)
 		return nil, err
 	}
+	defer stmt.Release()
 
-	return stmt.QueryxContext(ctx, args...)
+	rows, err := stmt.Stmt.QueryxContext(ctx, args...)
+	c.afterQuery(ctx, query, args, start, err)
+	return rows, err
 }
 
 func (c *Cache) Get(dest interface{}, query string, args ...interface{}) error {
-	stmt, err := c.stmt(query)
-	if err != nil {
-		return err
-	}
-
-	return stmt.Get(dest, args...)
+	return c.GetContext(context.Background(), dest, query, args...)
 }
 
 func (c *Cache) GetContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
-	stmt, err := c.stmtContext(ctx, query)
+	ctx, start := c.beforeQuery(ctx, query, args)
+	stmt, ctx, err := c.readNodeContext(ctx).stmtContext(ctx, c.hooks, query)
 	if err != nil {
+		c.afterQuery(ctx, query, args, start, err)
 		return err
 	}
+	defer stmt.Release()
 
-	return stmt.GetContext(ctx, dest, args...)
+	err = stmt.Stmt.GetContext(ctx, dest, args...)
+	c.afterQuery(ctx, query, args, start, err)
+	return err
 }
 
 func (c *Cache) NamedGet(dest interface{}, query string, arg interface{}) error {
-	namedStmt, err := c.namedStmt(query)
-	if err != nil {
-		return err
-	}
-
-	return namedStmt.Get(dest, arg)
+	return c.NamedGetContext(context.Background(), dest, query, arg)
 }
 
 func (c *Cache) NamedGetContext(ctx context.Context, dest interface{}, query string, arg interface{}) error {
-	namedStmt, err := c.namedStmtContext(ctx, query)
+	ctx, start := c.beforeQuery(ctx, query, []interface{}{arg})
+	namedStmt, ctx, err := c.readNodeContext(ctx).namedStmtContext(ctx, c.hooks, query)
 	if err != nil {
+		c.afterQuery(ctx, query, []interface{}{arg}, start, err)
 		return err
 	}
+	defer namedStmt.Release()
 
-	return namedStmt.GetContext(ctx, dest, arg)
+	err = namedStmt.Stmt.GetContext(ctx, dest, arg)
+	c.afterQuery(ctx, query, []interface{}{arg}, start, err)
+	return err
 }
 
 func (c *Cache) Select(dest interface{}, query string, args ...interface{}) error {
-	stmt, err := c.stmt(query)
-	if err != nil {
-		return err
-	}
-
-	return stmt.Select(dest, args...)
+	return c.SelectContext(context.Background(), dest, query, args...)
 }
 
 func (c *Cache) SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
-	stmt, err := c.stmtContext(ctx, query)
+	ctx, start := c.beforeQuery(ctx, query, args)
+	stmt, ctx, err := c.readNodeContext(ctx).stmtContext(ctx, c.hooks, query)
 	if err != nil {
+		c.afterQuery(ctx, query, args, start, err)
 		return err
 	}
+	defer stmt.Release()
 
-	return stmt.SelectContext(ctx, dest, args...)
+	err = stmt.Stmt.SelectContext(ctx, dest, args...)
+	c.afterQuery(ctx, query, args, start, err)
+	return err
 }
 
 func (c *Cache) NamedSelect(dest interface{}, query string, arg interface{}) error {
-	namedStmt, err := c.namedStmt(query)
-	if err != nil {
-		return err
-	}
-
-	return namedStmt.Select(dest, arg)
+	return c.NamedSelectContext(context.Background(), dest, query, arg)
 }
 
 func (c *Cache) NamedSelectContext(ctx context.Context, dest interface{}, query string, arg interface{}) error {
-	namedStmt, err := c.namedStmtContext(ctx, query)
+	ctx, start := c.beforeQuery(ctx, query, []interface{}{arg})
+	namedStmt, ctx, err := c.readNodeContext(ctx).namedStmtContext(ctx, c.hooks, query)
 	if err != nil {
+		c.afterQuery(ctx, query, []interface{}{arg}, start, err)
 		return err
 	}
+	defer namedStmt.Release()
 
-	return namedStmt.SelectContext(ctx, dest, arg)
+	err = namedStmt.Stmt.SelectContext(ctx, dest, arg)
+	c.afterQuery(ctx, query, []interface{}{arg}, start, err)
+	return err
 }
 
 func (c *Cache) DB() *sqlx.DB {
-	return c.db
+	return c.primary.db
 }
 
+// Close closes every cached prepared statement (draining each node's LRU
+// regardless of outstanding references) and then the underlying *sqlx.DB
+// of the primary and every replica.
 func (c *Cache) Close() error {
-	return c.db.Close()
+	var firstErr error
+	for _, n := range c.allNodes() {
+		if err := n.close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return firstErr
 }
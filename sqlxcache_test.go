@@ -92,7 +92,7 @@ func BenchmarkCacheQueryx(b *testing.B) {
 		}
 	}()
 
-	if _, err := db.db.Exec(testDatabase); err != nil {
+	if _, err := db.DB().Exec(testDatabase); err != nil {
 		b.Fatal(err)
 	}
 
@@ -0,0 +1,204 @@
+package sqlxcache
+
+import (
+	"container/list"
+	"sync"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// CacheOptions bounds the size of a Cache's prepared-statement caches.
+// The zero value means unbounded: statements accumulate for the lifetime
+// of the Cache and are never evicted, which is the historical behavior.
+type CacheOptions struct {
+	// MaxStmts caps the number of unnamed prepared statements cached per
+	// underlying connection pool (the primary and each replica have their
+	// own cache). 0 means unbounded.
+	MaxStmts int
+
+	// MaxNamedStmts caps the number of named prepared statements cached
+	// per underlying connection pool. 0 means unbounded.
+	MaxNamedStmts int
+
+	// InExpansionBucket, when true, rounds the length of slice args passed
+	// to Cache.In (and its ExecIn/GetIn/SelectIn/QueryxIn wrappers) up to
+	// the next power of two before expansion, padding with SQL NULL. This
+	// trades a few wasted placeholders for a much smaller number of
+	// distinct expanded queries, which keeps IN-heavy workloads from
+	// blowing out the statement cache.
+	InExpansionBucket bool
+
+	// Hooks, if set, is notified before/after every query and prepare run
+	// through the Cache (and any Tx derived from it; Conn's own query
+	// methods do not call it), plus whether each query's statement was a
+	// statement-cache hit. See hooks.go.
+	Hooks Hooks
+}
+
+// resolveCacheOptions returns the single CacheOptions passed to a variadic
+// opts parameter, or the zero value (unbounded) if none was given.
+func resolveCacheOptions(opts []CacheOptions) CacheOptions {
+	if len(opts) == 0 {
+		return CacheOptions{}
+	}
+
+	return opts[0]
+}
+
+// closer is implemented by *sqlx.Stmt and *sqlx.NamedStmt.
+type closer interface {
+	Close() error
+}
+
+// cacheEntry is the value stored in an lruCache. Because a *sqlx.Stmt may
+// still be in use by a caller at the moment it falls off the end of the
+// LRU, eviction only marks the entry; the statement is actually closed
+// once refCount drops back to zero.
+type cacheEntry struct {
+	key      string
+	value    closer
+	refCount int
+	evicted  bool
+}
+
+// lruCache is a size-bounded, reference-counted cache of prepared
+// statements. Entries are evicted least-recently-used first, and eviction
+// defers Close() until every caller holding the entry has released it.
+type lruCache struct {
+	mu    sync.Mutex
+	max   int // <=0 means unbounded
+	ll    *list.List
+	items map[string]*list.Element
+}
+
+func newLRUCache(max int) *lruCache {
+	return &lruCache{
+		max:   max,
+		ll:    list.New(),
+		items: map[string]*list.Element{},
+	}
+}
+
+func (l *lruCache) setMax(max int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.max = max
+}
+
+// getOrCreate returns the entry for key, preparing it with create if it is
+// not already cached, and increments its reference count. The caller must
+// call release(entry) exactly once it is done with the returned entry.
+// hit reports whether key was already cached.
+func (l *lruCache) getOrCreate(key string, create func() (closer, error)) (entry *cacheEntry, hit bool, err error) {
+	l.mu.Lock()
+	if el, ok := l.items[key]; ok {
+		l.ll.MoveToFront(el)
+		entry := el.Value.(*cacheEntry)
+		entry.refCount++
+		l.mu.Unlock()
+		return entry, true, nil
+	}
+	l.mu.Unlock()
+
+	value, err := create()
+	if err != nil {
+		return nil, false, err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if el, ok := l.items[key]; ok {
+		// Lost the race: another caller prepared the same query first.
+		value.Close()
+		entry := el.Value.(*cacheEntry)
+		l.ll.MoveToFront(el)
+		entry.refCount++
+		return entry, true, nil
+	}
+
+	entry = &cacheEntry{key: key, value: value, refCount: 1}
+	el := l.ll.PushFront(entry)
+	l.items[key] = el
+
+	if l.max > 0 {
+		for l.ll.Len() > l.max {
+			oldest := l.ll.Back()
+			oldestEntry := oldest.Value.(*cacheEntry)
+			if oldestEntry == entry {
+				break
+			}
+
+			l.ll.Remove(oldest)
+			delete(l.items, oldestEntry.key)
+			l.evictLocked(oldestEntry)
+		}
+	}
+
+	return entry, false, nil
+}
+
+// evictLocked marks entry evicted, closing it immediately if nothing is
+// using it. l.mu must already be held.
+func (l *lruCache) evictLocked(entry *cacheEntry) {
+	entry.evicted = true
+	if entry.refCount == 0 {
+		entry.value.Close()
+	}
+}
+
+// release drops a reference acquired by getOrCreate, closing the
+// statement if it has since been evicted and this was the last reference.
+func (l *lruCache) release(entry *cacheEntry) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entry.refCount--
+	if entry.evicted && entry.refCount <= 0 {
+		entry.value.Close()
+	}
+}
+
+// closeAll evicts and closes every cached statement, regardless of
+// outstanding references. Used by Cache.Close.
+func (l *lruCache) closeAll() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var firstErr error
+	for el := l.ll.Front(); el != nil; el = el.Next() {
+		entry := el.Value.(*cacheEntry)
+		if err := entry.value.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	l.ll.Init()
+	l.items = map[string]*list.Element{}
+	return firstErr
+}
+
+// stmtHandle is a checked-out reference to a cached *sqlx.Stmt. Callers
+// must call Release once they are done executing against Stmt.
+type stmtHandle struct {
+	cache *lruCache
+	entry *cacheEntry
+	Stmt  *sqlx.Stmt
+}
+
+func (h *stmtHandle) Release() {
+	h.cache.release(h.entry)
+}
+
+// namedStmtHandle is a checked-out reference to a cached *sqlx.NamedStmt.
+// Callers must call Release once they are done executing against Stmt.
+type namedStmtHandle struct {
+	cache *lruCache
+	entry *cacheEntry
+	Stmt  *sqlx.NamedStmt
+}
+
+func (h *namedStmtHandle) Release() {
+	h.cache.release(h.entry)
+}
@@ -0,0 +1,107 @@
+package sqlxcache
+
+import "testing"
+
+// fakeCloser is a closer that records whether it has been closed, for
+// exercising lruCache eviction without a real *sqlx.Stmt.
+type fakeCloser struct {
+	closed bool
+}
+
+func (f *fakeCloser) Close() error {
+	f.closed = true
+	return nil
+}
+
+func newFakeCreate(f *fakeCloser) func() (closer, error) {
+	return func() (closer, error) {
+		return f, nil
+	}
+}
+
+func TestLRUCacheGetOrCreate(t *testing.T) {
+	l := newLRUCache(0)
+
+	a := &fakeCloser{}
+	entry, hit, err := l.getOrCreate("a", newFakeCreate(a))
+	if err != nil {
+		t.Fatalf("getOrCreate: %v", err)
+	}
+	if hit {
+		t.Error("first getOrCreate for a new key reported a hit")
+	}
+
+	entry2, hit, err := l.getOrCreate("a", newFakeCreate(&fakeCloser{}))
+	if err != nil {
+		t.Fatalf("getOrCreate: %v", err)
+	}
+	if !hit {
+		t.Error("second getOrCreate for the same key did not report a hit")
+	}
+	if entry2 != entry {
+		t.Error("second getOrCreate for the same key returned a different entry")
+	}
+}
+
+func TestLRUCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	l := newLRUCache(2)
+
+	a, b, c := &fakeCloser{}, &fakeCloser{}, &fakeCloser{}
+	entryA, _, _ := l.getOrCreate("a", newFakeCreate(a))
+	l.release(entryA)
+	entryB, _, _ := l.getOrCreate("b", newFakeCreate(b))
+	l.release(entryB)
+
+	// Touch "a" so "b" becomes the least-recently-used entry.
+	entryA, _, _ = l.getOrCreate("a", newFakeCreate(a))
+	l.release(entryA)
+
+	l.getOrCreate("c", newFakeCreate(c))
+
+	if !b.closed {
+		t.Error("least-recently-used entry b was not evicted and closed")
+	}
+	if a.closed {
+		t.Error("recently-touched entry a was evicted")
+	}
+	if c.closed {
+		t.Error("newly-inserted entry c was evicted")
+	}
+}
+
+func TestLRUCacheDefersCloseUntilReleased(t *testing.T) {
+	l := newLRUCache(1)
+
+	a := &fakeCloser{}
+	entryA, _, _ := l.getOrCreate("a", newFakeCreate(a))
+
+	// Evict "a" while it is still checked out.
+	l.getOrCreate("b", newFakeCreate(&fakeCloser{}))
+
+	if a.closed {
+		t.Error("evicted entry was closed while still referenced")
+	}
+
+	l.release(entryA)
+	if !a.closed {
+		t.Error("evicted entry was not closed once its last reference was released")
+	}
+}
+
+func TestLRUCacheCloseAllIgnoresOutstandingReferences(t *testing.T) {
+	l := newLRUCache(0)
+
+	a := &fakeCloser{}
+	l.getOrCreate("a", newFakeCreate(a))
+
+	if err := l.closeAll(); err != nil {
+		t.Fatalf("closeAll: %v", err)
+	}
+	if !a.closed {
+		t.Error("closeAll did not close an entry with an outstanding reference")
+	}
+
+	if _, hit, _ := l.getOrCreate("a", newFakeCreate(&fakeCloser{})); hit {
+		t.Error("closeAll left a stale entry behind")
+	}
+}